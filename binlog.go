@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// BinlogOptions configures the optional binlog-based cache invalidation.
+// When Enabled is false the filesystem behaves exactly as before, relying on
+// a full Readdir re-scan to pick up changes.
+type BinlogOptions struct {
+	Enabled  bool
+	ServerID uint32
+	GTID     string
+}
+
+// BinlogSubscriber tails the MySQL row-format binlog and turns row events
+// into targeted invalidations of tableMap / the FUSE inode cache, instead of
+// the Readdir-driven full re-scan.
+type BinlogSubscriber struct {
+	dsn  string
+	opts BinlogOptions
+	root *MySQLRoot
+}
+
+func NewBinlogSubscriber(dsn string, opts BinlogOptions, root *MySQLRoot) *BinlogSubscriber {
+	return &BinlogSubscriber{dsn: dsn, opts: opts, root: root}
+}
+
+// Run connects and tails the binlog until ctx is canceled, reconnecting from
+// the last committed GTID on any failure. On a server with GTID disabled it
+// falls back to resuming from the last synced binlog file/position instead,
+// so a reconnect doesn't silently drop events that occurred during the
+// outage. If the account lacks REPLICATION SLAVE it logs a warning and
+// returns, leaving the caller on poll mode.
+func (b *BinlogSubscriber) Run(ctx context.Context) {
+	gtid := b.opts.GTID
+	var pos mysql.Position
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		c, err := b.newCanal()
+		if err != nil {
+			if strings.Contains(err.Error(), "REPLICATION SLAVE") {
+				log.Printf("binlog: account lacks REPLICATION SLAVE, falling back to poll mode")
+				return
+			}
+			log.Printf("binlog: connect failed, retrying: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		c.SetEventHandler(&binlogHandler{root: b.root})
+
+		// Closing the canal is what stops a blocking run when ctx is canceled.
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.Close()
+			case <-done:
+			}
+		}()
+		runErr := b.runFrom(c, gtid, pos)
+		close(done)
+
+		if set := c.SyncedGTIDSet(); set != nil {
+			gtid = set.String()
+		}
+		pos = c.SyncedPosition()
+		c.Close()
+
+		if runErr == nil || ctx.Err() != nil {
+			return
+		}
+		log.Printf("binlog: lost connection, reconnecting from gtid=%q pos=%s: %v", gtid, pos, runErr)
+		time.Sleep(time.Second)
+	}
+}
+
+func (b *BinlogSubscriber) newCanal() (*canal.Canal, error) {
+	dsnCfg, err := mysqldriver.ParseDSN(b.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := canal.NewDefaultConfig()
+	cfg.Addr = dsnCfg.Addr
+	cfg.User = dsnCfg.User
+	cfg.Password = dsnCfg.Passwd
+	cfg.ServerID = b.opts.ServerID
+	cfg.Dump.ExecutionPath = ""
+
+	return canal.NewCanal(cfg)
+}
+
+func (b *BinlogSubscriber) runFrom(c *canal.Canal, gtid string, pos mysql.Position) error {
+	if gtid != "" {
+		if set, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, gtid); err == nil {
+			return c.StartFromGTID(set)
+		}
+	}
+	if pos.Name != "" {
+		return c.RunFrom(pos)
+	}
+	return c.Run()
+}
+
+// binlogHandler translates row events into tableMap/inode cache updates.
+type binlogHandler struct {
+	canal.DummyEventHandler
+	root *MySQLRoot
+}
+
+func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
+	value, ok := tableMap.Load(e.Table.Name)
+	if !ok {
+		return nil
+	}
+	m := value.(*sync.Map)
+	tableNode := h.root.EmbeddedInode().GetChild(e.Table.Name)
+	ext := h.root.opts.formatterFor(e.Table.Name).Ext()
+
+	switch e.Action {
+	case canal.InsertAction:
+		for _, row := range e.Rows {
+			key, ok := recordKey(e.Table, row)
+			if !ok {
+				continue
+			}
+			name := key.filename(ext)
+			m.Store(key.String(), &FileIndex{path: e.Table.Name, name: name, key: key})
+			if tableNode != nil {
+				tableNode.NotifyEntry(name)
+			}
+		}
+	case canal.UpdateAction:
+		// Rows holds before/after image pairs: e.Rows[2*i] is the old row,
+		// e.Rows[2*i+1] is the new one. A PK-changing update must drop the
+		// old key, not just add the new one, or the stale name lingers.
+		for i := 0; i+1 < len(e.Rows); i += 2 {
+			oldKey, ok := recordKey(e.Table, e.Rows[i])
+			if !ok {
+				continue
+			}
+			newKey, ok := recordKey(e.Table, e.Rows[i+1])
+			if !ok {
+				continue
+			}
+
+			if oldKey.String() != newKey.String() {
+				m.Delete(oldKey.String())
+				if tableNode != nil {
+					tableNode.NotifyDelete(oldKey.filename(ext), nil)
+				}
+			}
+
+			name := newKey.filename(ext)
+			m.Store(newKey.String(), &FileIndex{path: e.Table.Name, name: name, key: newKey})
+			if tableNode != nil {
+				tableNode.NotifyEntry(name)
+			}
+		}
+	case canal.DeleteAction:
+		for _, row := range e.Rows {
+			key, ok := recordKey(e.Table, row)
+			if !ok {
+				continue
+			}
+			m.Delete(key.String())
+			if tableNode != nil {
+				tableNode.NotifyDelete(key.filename(ext), nil)
+			}
+		}
+	}
+	return nil
+}
+
+// recordKey extracts a row's PKKey from a decoded binlog row, using the
+// table's PKColumns (already tracked by canal/go-mysql's schema cache) to
+// find the key values regardless of their position or count.
+func recordKey(table *schema.Table, row []interface{}) (PKKey, bool) {
+	if len(table.PKColumns) == 0 {
+		return nil, false
+	}
+
+	key := make(PKKey, len(table.PKColumns))
+	for i, col := range table.PKColumns {
+		if col >= len(row) {
+			return nil, false
+		}
+		key[i] = fmt.Sprintf("%v", row[col])
+	}
+	return key, true
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// predicate is one `col op literal` term of a `where/` path, e.g.
+// `status=active` or `age>30`.
+type predicate struct {
+	col string
+	op  string
+	val string
+}
+
+var (
+	limitSegmentRe     = regexp.MustCompile(`(?i)^limit=(\d+)$`)
+	orderSegmentRe     = regexp.MustCompile(`(?i)^order=([A-Za-z_][A-Za-z0-9_]*)$`)
+	predicateSegmentRe = regexp.MustCompile(`(?i)^([A-Za-z_][A-Za-z0-9_]*)\s*(>=|<=|!=|=|<|>|like)\s*(.+)$`)
+)
+
+// FilterNode is a virtual directory produced by walking into `table/where/`:
+// each further path segment either narrows the filter (`col op literal`),
+// sets `limit=N` / `order=col`, or names one of the resulting rows.
+type FilterNode struct {
+	fs.Inode
+	root  *MySQLRoot
+	table string
+	preds []predicate
+	limit int
+	order string
+}
+
+func NewFilterNode(root *MySQLRoot, table string, preds []predicate, limit int, order string) *FilterNode {
+	return &FilterNode{root: root, table: table, preds: preds, limit: limit, order: order}
+}
+
+func (f *FilterNode) whereClause() (string, []interface{}) {
+	if len(f.preds) == 0 {
+		return "", nil
+	}
+	conds := make([]string, len(f.preds))
+	args := make([]interface{}, len(f.preds))
+	for i, p := range f.preds {
+		conds[i] = fmt.Sprintf("`%s` %s ?", p.col, sqlOperator(p.op))
+		args[i] = p.val
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+func sqlOperator(op string) string {
+	if strings.EqualFold(op, "like") {
+		return "LIKE"
+	}
+	return op
+}
+
+func (f *FilterNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	pk, err := f.root.primaryKey(ctx, f.table)
+	if err != nil || len(pk) == 0 {
+		return nil, syscall.ENOTSUP
+	}
+
+	query, args, errno := f.buildQuery(ctx, pk)
+	if errno != fs.OK {
+		return nil, errno
+	}
+
+	rows, err := f.root.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	defer rows.Close()
+
+	ext := f.root.opts.formatterFor(f.table).Ext()
+	list := []fuse.DirEntry{}
+	for rows.Next() {
+		key, err := scanKey(rows, len(pk))
+		if err != nil {
+			return nil, syscall.EIO
+		}
+		list = append(list, fuse.DirEntry{Name: key.filename(ext), Mode: 0644 | uint32(syscall.S_IFREG)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, syscall.EIO
+	}
+
+	return fs.NewListDirStream(list), fs.OK
+}
+
+func (f *FilterNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if m := limitSegmentRe.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		sa := fs.StableAttr{Mode: 0555 | uint32(syscall.S_IFDIR)}
+		return f.NewInode(ctx, NewFilterNode(f.root, f.table, f.preds, n, f.order), sa), fs.OK
+	}
+
+	if m := orderSegmentRe.FindStringSubmatch(name); m != nil {
+		ok, err := f.root.hasColumn(ctx, f.table, m[1])
+		if err != nil {
+			return nil, syscall.EIO
+		}
+		if !ok {
+			return nil, syscall.EINVAL
+		}
+		sa := fs.StableAttr{Mode: 0555 | uint32(syscall.S_IFDIR)}
+		return f.NewInode(ctx, NewFilterNode(f.root, f.table, f.preds, f.limit, m[1]), sa), fs.OK
+	}
+
+	if m := predicateSegmentRe.FindStringSubmatch(name); m != nil {
+		col := m[1]
+		ok, err := f.root.hasColumn(ctx, f.table, col)
+		if err != nil {
+			return nil, syscall.EIO
+		}
+		if !ok {
+			return nil, syscall.EINVAL
+		}
+		preds := append(append([]predicate{}, f.preds...), predicate{col: col, op: m[2], val: m[3]})
+		sa := fs.StableAttr{Mode: 0555 | uint32(syscall.S_IFDIR)}
+		return f.NewInode(ctx, NewFilterNode(f.root, f.table, preds, f.limit, f.order), sa), fs.OK
+	}
+
+	return f.lookupRecord(ctx, name)
+}
+
+// lookupRecord treats name as a record filename within the filtered result
+// set, e.g. `alice.json` under `users/where/status=active/`.
+func (f *FilterNode) lookupRecord(ctx context.Context, name string) (*fs.Inode, syscall.Errno) {
+	pk, err := f.root.primaryKey(ctx, f.table)
+	if err != nil || len(pk) == 0 {
+		return nil, syscall.ENOENT
+	}
+
+	key, err := parsePKKey(name, f.root.opts.formatterFor(f.table).Ext(), len(pk))
+	if err != nil {
+		return nil, syscall.ENOENT
+	}
+
+	where, args := f.whereClause()
+	rowCond, rowArgs := rowWhere(pk, key)
+	if where == "" {
+		where = "WHERE " + rowCond
+	} else {
+		where += " AND " + rowCond
+	}
+	args = append(args, rowArgs...)
+
+	var exists int
+	query := fmt.Sprintf("SELECT 1 FROM `%s` %s LIMIT 1", f.table, where)
+	if err := f.root.db.QueryRowContext(ctx, query, args...).Scan(&exists); err != nil {
+		return nil, syscall.ENOENT
+	}
+
+	sa := fs.StableAttr{Mode: 0644 | uint32(syscall.S_IFREG)}
+	return f.NewInode(ctx, NewRecordNode(f.root, f.table, pk, key), sa), fs.OK
+}
+
+// buildQuery renders the SELECT for Readdir: the filter's WHERE, plus an
+// optional ORDER BY/LIMIT, over the table's pk columns.
+func (f *FilterNode) buildQuery(ctx context.Context, pk []pkColumn) (string, []interface{}, syscall.Errno) {
+	for _, p := range f.preds {
+		ok, err := f.root.hasColumn(ctx, f.table, p.col)
+		if err != nil {
+			return "", nil, syscall.EIO
+		}
+		if !ok {
+			return "", nil, syscall.EINVAL
+		}
+	}
+	if f.order != "" {
+		ok, err := f.root.hasColumn(ctx, f.table, f.order)
+		if err != nil {
+			return "", nil, syscall.EIO
+		}
+		if !ok {
+			return "", nil, syscall.EINVAL
+		}
+	}
+
+	names := make([]string, len(pk))
+	for i, c := range pk {
+		names[i] = fmt.Sprintf("`%s`", c.Name)
+	}
+
+	where, args := f.whereClause()
+	query := fmt.Sprintf("SELECT %s FROM `%s` %s", strings.Join(names, ", "), f.table, where)
+	if f.order != "" {
+		query += fmt.Sprintf(" ORDER BY `%s`", f.order)
+	}
+	if f.limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.limit)
+	}
+	return query, args, fs.OK
+}
+
+func scanKey(rows *sql.Rows, numCols int) (PKKey, error) {
+	raw := make([]sql.RawBytes, numCols)
+	ptrs := make([]interface{}, numCols)
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+
+	key := make(PKKey, numCols)
+	for i, v := range raw {
+		key[i] = string(v)
+	}
+	return key, nil
+}
+
+// columnCache memoizes each table's column names so path segments can be
+// validated as real identifiers before being embedded in a query, the same
+// way pkCache avoids re-querying information_schema on every lookup.
+// Entries expire after schemaCacheTTL so an ALTER TABLE that adds or drops a
+// column is picked up without a remount.
+var columnCache sync.Map // map[string]columnCacheEntry
+
+type columnCacheEntry struct {
+	cols    []string
+	expires time.Time
+}
+
+// hasColumn reports whether col is a real column of table. The error return
+// is a lookup failure (e.g. lost connection), distinct from col simply not
+// existing, so callers can tell EIO from EINVAL.
+func (r *MySQLRoot) hasColumn(ctx context.Context, table string, col string) (bool, error) {
+	cols, err := r.tableColumnNames(ctx, table)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range cols {
+		if c == col {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MySQLRoot) tableColumnNames(ctx context.Context, table string) ([]string, error) {
+	if v, ok := columnCache.Load(table); ok {
+		e := v.(columnCacheEntry)
+		if time.Now().Before(e.expires) {
+			return e.cols, nil
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ?
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	columnCache.Store(table, columnCacheEntry{cols: cols, expires: time.Now().Add(schemaCacheTTL)})
+	return cols, nil
+}
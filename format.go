@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RowFormatter serializes a row to its on-disk representation and parses it
+// back. Read/Write on a RecordNode round-trip through whichever formatter
+// the table is configured to use.
+type RowFormatter interface {
+	// Ext is the file extension used for record names, e.g. "json".
+	Ext() string
+	// Format renders cols/values (in column order) as file content.
+	Format(table string, cols []string, values []string) ([]byte, error)
+	// Parse turns file content back into column -> value.
+	Parse(data []byte) (map[string]string, error)
+}
+
+// formatters is the registry of built-in RowFormatters, keyed by the name
+// passed to --format / --table-format.
+var formatters = map[string]RowFormatter{
+	"sql":  sqlFormatter{},
+	"json": jsonFormatter{},
+	"yaml": yamlFormatter{},
+	"csv":  csvFormatter{},
+}
+
+// formatterFor resolves the RowFormatter for a table, honoring a per-table
+// override over the global --format default, and falling back to sql if
+// the configured name is unknown.
+func (o Options) formatterFor(table string) RowFormatter {
+	name := o.Format
+	if override, ok := o.TableFormats[table]; ok {
+		name = override
+	}
+	if f, ok := formatters[name]; ok {
+		return f
+	}
+	return formatters["sql"]
+}
+
+type sqlFormatter struct{}
+
+func (sqlFormatter) Ext() string { return "sql" }
+
+func (sqlFormatter) Format(table string, cols []string, values []string) ([]byte, error) {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	stmt := fmt.Sprintf("INSERT INTO `%s` (`%s`) VALUES (%s);\n",
+		table, strings.Join(cols, "`, `"), strings.Join(quoted, ", "))
+	return []byte(stmt), nil
+}
+
+// Parse re-derives the column/value lists by tokenizing the statement
+// quote- and paren-aware, rather than a regex/naive-split: a value produced
+// by Format can itself contain ')' or ',' (e.g. "Smith, John (Jr.)"), which
+// would otherwise truncate or mis-split the VALUES list.
+func (sqlFormatter) Parse(data []byte) (map[string]string, error) {
+	s := string(data)
+	lower := strings.ToLower(s)
+	i := strings.Index(lower, "insert into")
+	if i < 0 {
+		return nil, fmt.Errorf("could not parse INSERT statement")
+	}
+	s = strings.TrimSpace(s[i+len("insert into"):])
+
+	s = skipIdentifier(s)
+	s = strings.TrimSpace(s)
+
+	colsPart, rest, err := readParenGroup(s)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse column list: %w", err)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(strings.ToLower(rest), "values") {
+		return nil, fmt.Errorf("could not parse INSERT statement: expected VALUES")
+	}
+	rest = strings.TrimSpace(rest[len("values"):])
+
+	valsPart, _, err := readParenGroup(rest)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse value list: %w", err)
+	}
+
+	cols := splitSQLList(colsPart)
+	for i, c := range cols {
+		cols[i] = strings.Trim(strings.TrimSpace(c), "`")
+	}
+	vals := splitSQLList(valsPart)
+	for i, v := range vals {
+		v = strings.TrimSpace(v)
+		v = strings.TrimPrefix(v, "'")
+		v = strings.TrimSuffix(v, "'")
+		vals[i] = strings.ReplaceAll(v, "''", "'")
+	}
+	if len(cols) != len(vals) {
+		return nil, fmt.Errorf("column/value count mismatch")
+	}
+
+	row := make(map[string]string, len(cols))
+	for i, c := range cols {
+		row[c] = vals[i]
+	}
+	return row, nil
+}
+
+// skipIdentifier drops a backtick-quoted or bare identifier from the front
+// of s, returning what follows it.
+func skipIdentifier(s string) string {
+	if strings.HasPrefix(s, "`") {
+		if end := strings.Index(s[1:], "`"); end >= 0 {
+			return s[end+2:]
+		}
+		return ""
+	}
+	i := 0
+	for i < len(s) && s[i] != '(' && !isSQLSpace(s[i]) {
+		i++
+	}
+	return s[i:]
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// readParenGroup reads a balanced, quote-aware "(...)" group from the start
+// of s, returning its inner content and whatever follows the closing paren.
+func readParenGroup(s string) (inner string, rest string, err error) {
+	if len(s) == 0 || s[0] != '(' {
+		return "", s, fmt.Errorf("expected '('")
+	}
+
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote:
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					inQuote = false
+				}
+			}
+		case c == '\'':
+			inQuote = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("unterminated '('")
+}
+
+// splitSQLList splits a top-level comma-separated list, treating commas and
+// parens inside a '...'-quoted literal as part of the value rather than
+// separators.
+func splitSQLList(s string) []string {
+	var out []string
+	var cur strings.Builder
+	inQuote := false
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote:
+			cur.WriteByte(c)
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					cur.WriteByte(s[i+1])
+					i++
+				} else {
+					inQuote = false
+				}
+			}
+		case c == '\'':
+			inQuote = true
+			cur.WriteByte(c)
+		case c == '(':
+			depth++
+			cur.WriteByte(c)
+		case c == ')':
+			depth--
+			cur.WriteByte(c)
+		case c == ',' && depth == 0:
+			out = append(out, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	out = append(out, strings.TrimSpace(cur.String()))
+	return out
+}
+
+type jsonFormatter struct{}
+
+func (jsonFormatter) Ext() string { return "json" }
+
+func (jsonFormatter) Format(table string, cols []string, values []string) ([]byte, error) {
+	row := make(map[string]string, len(cols))
+	for i, c := range cols {
+		row[c] = values[i]
+	}
+	data, err := json.MarshalIndent(row, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (jsonFormatter) Parse(data []byte) (map[string]string, error) {
+	row := map[string]string{}
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+type yamlFormatter struct{}
+
+func (yamlFormatter) Ext() string { return "yaml" }
+
+func (yamlFormatter) Format(table string, cols []string, values []string) ([]byte, error) {
+	row := make(map[string]string, len(cols))
+	for i, c := range cols {
+		row[c] = values[i]
+	}
+	return yaml.Marshal(row)
+}
+
+func (yamlFormatter) Parse(data []byte) (map[string]string, error) {
+	row := map[string]string{}
+	if err := yaml.Unmarshal(data, &row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+type csvFormatter struct{}
+
+func (csvFormatter) Ext() string { return "csv" }
+
+func (csvFormatter) Format(table string, cols []string, values []string) ([]byte, error) {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	if err := w.Write(cols); err != nil {
+		return nil, err
+	}
+	if err := w.Write(values); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return []byte(sb.String()), nil
+}
+
+func (csvFormatter) Parse(data []byte) (map[string]string, error) {
+	r := csv.NewReader(strings.NewReader(string(data)))
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("expected a header row and a value row")
+	}
+	cols, vals := records[0], records[1]
+	if len(cols) != len(vals) {
+		return nil, fmt.Errorf("column/value count mismatch")
+	}
+
+	row := make(map[string]string, len(cols))
+	for i, c := range cols {
+		row[c] = vals[i]
+	}
+	return row, nil
+}
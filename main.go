@@ -2,23 +2,67 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 )
 
+// tableFormatFlag collects repeated `-table-format table=format` flags into
+// a table -> format name map.
+type tableFormatFlag map[string]string
+
+func (f tableFormatFlag) String() string {
+	return fmt.Sprintf("%v", map[string]string(f))
+}
+
+func (f tableFormatFlag) Set(value string) error {
+	table, format, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected table=format, got %q", value)
+	}
+	f[table] = format
+	return nil
+}
+
 func main() {
 	debug := flag.Bool("debug", false, "print debug data")
 	dsn := flag.String("dsn", "", "data source name")
+	binlog := flag.Bool("binlog", false, "subscribe to the MySQL binlog for live cache invalidation instead of polling")
+	serverID := flag.Uint("server-id", 1000, "server-id to present to MySQL when tailing the binlog")
+	gtid := flag.String("gtid", "", "GTID set to resume the binlog subscription from")
+	readOnly := flag.Bool("read-only", false, "disallow writes, creates and deletes; preserve today's read-only behavior")
+	format := flag.String("format", "sql", "row serialization format: sql, json, yaml or csv")
+	tableFormats := make(tableFormatFlag)
+	flag.Var(tableFormats, "table-format", "per-table format override, e.g. -table-format users=json (repeatable)")
+	noPKStrategy := flag.String("no-pk-strategy", "skip", "how to handle tables with no primary key: skip, rowid or unique:<index name>")
 	flag.Parse()
 	if len(flag.Args()) < 1 {
 		log.Fatal("Usage:\n  hello MOUNTPOINT")
 	}
-	opts := &fs.Options{}
-	opts.Debug = *debug
+
+	noPK, err := ParseNoPKStrategy(*noPKStrategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fuseOpts := &fs.Options{}
+	fuseOpts.Debug = *debug
 	p := flag.Arg(0)
-	root := NewMySQLRoot(*dsn, "/", nil, true)
-	server, err := fs.Mount(p, root, opts)
+	rootOpts := Options{
+		Debug: *debug,
+		Binlog: BinlogOptions{
+			Enabled:  *binlog,
+			ServerID: uint32(*serverID),
+			GTID:     *gtid,
+		},
+		ReadOnly:     *readOnly,
+		Format:       *format,
+		TableFormats: tableFormats,
+		NoPKStrategy: noPK,
+	}
+	root := NewMySQLRoot(*dsn, "/", nil, rootOpts)
+	server, err := fs.Mount(p, root, fuseOpts)
 	if err != nil {
 		log.Fatalf("Mount fail: %v\n", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 
@@ -16,24 +17,39 @@ import (
 type FileIndex struct {
 	path string
 	name string
+	key  PKKey
 }
 
 var tableMap sync.Map // map[string]*sync.Map, value sync.Map is map[string]*FileIndex
 
+// Options holds the flags that are shared by every MySQLRoot/RecordNode in
+// the tree; unlike dsn/path/db it never changes as we descend into children.
+type Options struct {
+	Debug    bool
+	Binlog   BinlogOptions
+	ReadOnly bool
+	// Format is the default RowFormatter name (sql/json/yaml/csv).
+	Format string
+	// TableFormats overrides Format for specific tables.
+	TableFormats map[string]string
+	// NoPKStrategy controls how tables without a primary key are handled.
+	NoPKStrategy NoPKStrategy
+}
+
 type MySQLRoot struct {
 	fs.Inode
-	dsn   string
-	path  string
-	db    *sql.DB
-	debug bool
+	dsn  string
+	path string
+	db   *sql.DB
+	opts Options
 }
 
-func NewMySQLRoot(dsn string, path string, db *sql.DB, debug bool) *MySQLRoot {
+func NewMySQLRoot(dsn string, path string, db *sql.DB, opts Options) *MySQLRoot {
 	return &MySQLRoot{
-		dsn:   dsn,
-		path:  path,
-		db:    db,
-		debug: debug,
+		dsn:  dsn,
+		path: path,
+		db:   db,
+		opts: opts,
 	}
 }
 
@@ -41,7 +57,7 @@ var _ = (fs.NodeOnAdder)((*MySQLRoot)(nil))
 
 func (r *MySQLRoot) OnAdd(ctx context.Context) {
 	path := r.Path(nil)
-	if r.debug {
+	if r.opts.Debug {
 		fmt.Printf("OnAdd: [%s]\n", path)
 	}
 
@@ -50,11 +66,15 @@ func (r *MySQLRoot) OnAdd(ctx context.Context) {
 		panic(err)
 	}
 	r.db = db
+
+	if path == "" && r.opts.Binlog.Enabled {
+		go NewBinlogSubscriber(r.dsn, r.opts.Binlog, r).Run(context.Background())
+	}
 }
 
 func (r *MySQLRoot) Opendir(ctx context.Context) syscall.Errno {
 	path := r.Path(nil)
-	if r.debug {
+	if r.opts.Debug {
 		fmt.Printf("Opendir: [%s]\n", path)
 	}
 
@@ -63,7 +83,7 @@ func (r *MySQLRoot) Opendir(ctx context.Context) syscall.Errno {
 
 func (r *MySQLRoot) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 	path := r.Path(nil)
-	if r.debug {
+	if r.opts.Debug {
 		fmt.Printf("Readdir: [%s]\n", path)
 	}
 
@@ -74,58 +94,98 @@ func (r *MySQLRoot) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 			return nil, syscall.ENOENT
 		}
 
-		// rebuild index map
-		tableMap.Range(func(key, value interface{}) bool {
-			tableMap.Delete(key)
-			return true
-		})
-
-		list := []fuse.DirEntry{}
+		// Reconcile rather than wipe: a binlog subscriber may have already
+		// populated a table's inner map between Readdirs, and nuking
+		// tableMap here would throw that work away for no reason.
+		seen := make(map[string]bool, len(tables))
+		list := []fuse.DirEntry{
+			{Name: "_schema", Mode: 0555 | uint32(syscall.S_IFDIR)},
+		}
 		for i, table := range tables {
+			seen[table] = true
 			d := fuse.DirEntry{
 				Name: table,
-				Ino:  uint64(i),
+				Ino:  uint64(i + 1),
 				Mode: 0755 | uint32(syscall.S_IFDIR),
 			}
 			list = append(list, d)
-			tableMap.Store(table, &sync.Map{})
+			tableMap.LoadOrStore(table, &sync.Map{})
 		}
 
+		tableMap.Range(func(key, value interface{}) bool {
+			if !seen[key.(string)] {
+				tableMap.Delete(key)
+			}
+			return true
+		})
+
 		return fs.NewListDirStream(list), fs.OK
 	} else {
 		// table dir, fetch records
-		ids, err := r.getRecordIDs(ctx, path)
+		keys, err := r.getRecordKeys(ctx, path)
 		if err != nil {
 			return nil, syscall.ENOENT
 		}
 
-		list := []fuse.DirEntry{}
-		value, _ := tableMap.Load(path)
+		ext := r.opts.formatterFor(path).Ext()
+
+		value, _ := tableMap.LoadOrStore(path, &sync.Map{})
 		m := value.(*sync.Map)
-		m.Range(func(kk, vv interface{}) bool {
-			m.Delete(kk)
-			return true
-		})
 
-		for _, id := range ids {
+		// Reconcile against the fresh scan instead of wiping m, so a
+		// binlog-maintained entry added since the last Readdir survives
+		// one of ours instead of being discarded.
+		seen := make(map[string]bool, len(keys))
+		list := []fuse.DirEntry{}
+		for _, key := range keys {
+			name := key.filename(ext)
+			ks := key.String()
+			seen[ks] = true
 			d := fuse.DirEntry{
-				Name: fmt.Sprintf("%d.sql", id),
-				Ino:  uint64(100 + id),
+				Name: name,
 				Mode: 0644 | uint32(syscall.S_IFREG),
 			}
 			list = append(list, d)
-			m.Store(id, &FileIndex{path: path, name: d.Name})
+			m.Store(ks, &FileIndex{path: path, name: name, key: key})
+		}
+
+		// Only prune entries missing from this snapshot when nothing else is
+		// keeping m up to date: with the binlog subscriber running, a row
+		// deleted concurrently with this scan is already being removed by
+		// its own DeleteAction, and a row inserted concurrently would
+		// otherwise get wiped right back out here for having missed this
+		// snapshot.
+		if !r.opts.Binlog.Enabled {
+			m.Range(func(kk, vv interface{}) bool {
+				if !seen[kk.(string)] {
+					m.Delete(kk)
+				}
+				return true
+			})
 		}
+
 		return fs.NewListDirStream(list), fs.OK
 	}
 }
 
 func (r *MySQLRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
 	childPath := filepath.Join(r.Path(nil), name)
-	if r.debug {
+	if r.opts.Debug {
 		fmt.Printf("Lookup: [%s]\n", childPath)
 	}
 
+	if r.Path(nil) == "" && name == "_schema" {
+		sa := fs.StableAttr{Mode: 0555 | uint32(syscall.S_IFDIR)}
+		return r.NewInode(ctx, NewSchemaRoot(r), sa), fs.OK
+	}
+
+	if name == "where" {
+		if _, ok := tableMap.Load(r.Path(nil)); ok {
+			sa := fs.StableAttr{Mode: 0555 | uint32(syscall.S_IFDIR)}
+			return r.NewInode(ctx, NewFilterNode(r, r.Path(nil), nil, 0, ""), sa), fs.OK
+		}
+	}
+
 	var childNode *fs.Inode
 	tableMap.Range(func(key, value interface{}) bool {
 		if childPath == key {
@@ -133,18 +193,23 @@ func (r *MySQLRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut)
 			sa := fs.StableAttr{
 				Mode: 0755 | uint32(syscall.S_IFDIR),
 			}
-			childNode = r.NewInode(ctx, NewMySQLRoot(r.dsn, r.path, r.db, r.debug), sa)
+			childNode = r.NewInode(ctx, NewMySQLRoot(r.dsn, r.path, r.db, r.opts), sa)
 			return false
 		}
 
+		table := key.(string)
 		m := value.(*sync.Map)
 		m.Range(func(kk, vv interface{}) bool {
 			fi := vv.(*FileIndex)
-			if childPath == fi.path {
+			if childPath == filepath.Join(fi.path, fi.name) {
+				pk, err := r.primaryKey(ctx, table)
+				if err != nil {
+					return false
+				}
 				sa := fs.StableAttr{
 					Mode: 0644 | uint32(syscall.S_IFREG),
 				}
-				childNode = r.NewInode(ctx, NewMySQLRoot(r.dsn, r.path, r.db, r.debug), sa)
+				childNode = r.NewInode(ctx, NewRecordNode(r, table, pk, fi.key), sa)
 				return false
 			}
 			return true
@@ -159,40 +224,127 @@ func (r *MySQLRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut)
 	return nil, syscall.ENOENT
 }
 
-func (r *MySQLRoot) getTables(ctx context.Context) ([]string, error) {
-	rows, err := r.db.QueryContext(ctx, "SHOW tables")
+var (
+	_ = (fs.NodeCreater)((*MySQLRoot)(nil))
+	_ = (fs.NodeUnlinker)((*MySQLRoot)(nil))
+)
+
+// Create handles `echo ... > t/new.sql`: a name whose key isn't already
+// known is treated as an INSERT. A single auto-increment column can target
+// `0.sql`; the real value is taken from LastInsertId once the row exists.
+// Composite or non-numeric keys must name the actual key values to insert.
+func (r *MySQLRoot) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if r.opts.ReadOnly {
+		return nil, nil, 0, syscall.EROFS
+	}
+
+	table := r.Path(nil)
+	pk, err := r.primaryKey(ctx, table)
+	if err != nil || len(pk) == 0 {
+		return nil, nil, 0, syscall.EINVAL
+	}
+
+	key, err := parsePKKey(name, r.opts.formatterFor(table).Ext(), len(pk))
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, syscall.EINVAL
 	}
-	defer rows.Close()
 
-	var tables []string
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			continue
+	if len(pk) == 1 && key[0] == "0" {
+		res, execErr := r.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO `%s` () VALUES ()", table))
+		if execErr != nil {
+			return nil, nil, 0, syscall.EIO
+		}
+		id, idErr := res.LastInsertId()
+		if idErr != nil {
+			return nil, nil, 0, syscall.EIO
+		}
+		key = PKKey{fmt.Sprintf("%d", id)}
+	} else {
+		names := make([]string, len(pk))
+		placeholders := make([]string, len(pk))
+		args := make([]interface{}, len(pk))
+		for i, c := range pk {
+			names[i] = fmt.Sprintf("`%s`", c.Name)
+			placeholders[i] = "?"
+			args[i] = key[i]
+		}
+		query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", table,
+			strings.Join(names, ", "), strings.Join(placeholders, ", "))
+		if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+			return nil, nil, 0, syscall.EIO
 		}
-		tables = append(tables, tableName)
 	}
 
-	return tables, rows.Err()
+	ext := r.opts.formatterFor(table).Ext()
+	value, _ := tableMap.LoadOrStore(table, &sync.Map{})
+	m := value.(*sync.Map)
+	m.Store(key.String(), &FileIndex{path: table, name: key.filename(ext), key: key})
+
+	sa := fs.StableAttr{Mode: 0644 | uint32(syscall.S_IFREG)}
+	node := r.NewInode(ctx, NewRecordNode(r, table, pk, key), sa)
+	return node, nil, 0, fs.OK
+}
+
+// Unlink handles `rm t/42.sql`, issuing a DELETE for the corresponding row.
+func (r *MySQLRoot) Unlink(ctx context.Context, name string) syscall.Errno {
+	if r.opts.ReadOnly {
+		return syscall.EROFS
+	}
+
+	table := r.Path(nil)
+	pk, err := r.primaryKey(ctx, table)
+	if err != nil || len(pk) == 0 {
+		return syscall.EINVAL
+	}
+
+	key, err := parsePKKey(name, r.opts.formatterFor(table).Ext(), len(pk))
+	if err != nil {
+		return syscall.EINVAL
+	}
+
+	where, args := rowWhere(pk, key)
+	if _, err := r.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE %s", table, where), args...); err != nil {
+		return syscall.EIO
+	}
+
+	if value, ok := tableMap.Load(table); ok {
+		value.(*sync.Map).Delete(key.String())
+	}
+	return fs.OK
+}
+
+// validateTable rejects a path-derived table name that isn't one of the
+// database's actual tables, so callers that interpolate it into SQL (where
+// it can't be bound as a `?` parameter, e.g. inside backticks) don't hand an
+// arbitrary identifier straight to the server.
+func (r *MySQLRoot) validateTable(ctx context.Context, table string) error {
+	tables, err := r.getTables(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if t == table {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown table %q", table)
 }
 
-func (r *MySQLRoot) getRecordIDs(ctx context.Context, table string) ([]int64, error) {
-	rows, err := r.db.QueryContext(ctx, fmt.Sprintf("SELECT id FROM `%s`", table))
+func (r *MySQLRoot) getTables(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SHOW tables")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var ids []int64
+	var tables []string
 	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err != nil {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
 			continue
 		}
-		ids = append(ids, id)
+		tables = append(tables, tableName)
 	}
 
-	return ids, rows.Err()
+	return tables, rows.Err()
 }
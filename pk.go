@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pkColumn describes one column of a table's primary (or designated unique)
+// key.
+type pkColumn struct {
+	Name string
+	Type string
+}
+
+// pkCache memoizes the discovered key columns per table, analogous to
+// tableMap: querying information_schema on every Readdir/Lookup would be
+// wasteful since the schema rarely changes. Entries expire after
+// schemaCacheTTL so an ALTER TABLE that changes the key is picked up without
+// a remount, same as schemaCache.
+var pkCache sync.Map // map[string]pkCacheEntry
+
+type pkCacheEntry struct {
+	cols    []pkColumn
+	expires time.Time
+}
+
+// PKKey is the tuple of key-column values identifying one row, in column
+// order. A single-column key renders as `alice.json`; a composite key
+// renders as `(7,2024).json`.
+type PKKey []string
+
+func (k PKKey) filename(ext string) string {
+	return k.String() + "." + ext
+}
+
+func (k PKKey) String() string {
+	if len(k) == 1 {
+		return escapePKComponent(k[0])
+	}
+	parts := make([]string, len(k))
+	for i, v := range k {
+		parts[i] = escapePKComponent(v)
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+// pkUnsafe is the set of characters that would be ambiguous or unsafe in a
+// filename built from PK values: '/' (path separator), '(', ')', ','
+// (tuple syntax) and '%' (the escape character itself).
+const pkUnsafe = "/(),%"
+
+func escapePKComponent(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if strings.IndexByte(pkUnsafe, c) >= 0 || c < 0x20 {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func unescapePKComponent(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("truncated %%-escape in %q", s)
+		}
+		b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid %%-escape in %q: %w", s, err)
+		}
+		sb.WriteByte(byte(b))
+		i += 2
+	}
+	return sb.String(), nil
+}
+
+// parsePKKey parses a record filename like "42.json" or "(7,2024).json"
+// back into its PKKey, given how many key columns the table has.
+func parsePKKey(name string, ext string, numCols int) (PKKey, error) {
+	base := strings.TrimSuffix(name, "."+ext)
+
+	var parts []string
+	if strings.HasPrefix(base, "(") && strings.HasSuffix(base, ")") {
+		parts = strings.Split(base[1:len(base)-1], ",")
+	} else {
+		parts = []string{base}
+	}
+
+	if len(parts) != numCols {
+		return nil, fmt.Errorf("expected %d key column(s), got %d in %q", numCols, len(parts), name)
+	}
+
+	key := make(PKKey, len(parts))
+	for i, p := range parts {
+		v, err := unescapePKComponent(p)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = v
+	}
+	return key, nil
+}
+
+// NoPKStrategy controls how tables without a primary key are handled, since
+// getRecordKeys has no key columns to build filenames or WHERE clauses from.
+type NoPKStrategy struct {
+	// Mode is "skip" (default), "rowid" or "unique".
+	Mode string
+	// Index is the unique index name to fall back to when Mode == "unique".
+	Index string
+}
+
+// ParseNoPKStrategy parses the --no-pk-strategy flag value: "skip", "rowid"
+// or "unique:<index name>".
+func ParseNoPKStrategy(s string) (NoPKStrategy, error) {
+	if s == "" || s == "skip" {
+		return NoPKStrategy{Mode: "skip"}, nil
+	}
+	if s == "rowid" {
+		return NoPKStrategy{Mode: "rowid"}, nil
+	}
+	if index, ok := strings.CutPrefix(s, "unique:"); ok && index != "" {
+		return NoPKStrategy{Mode: "unique", Index: index}, nil
+	}
+	return NoPKStrategy{}, fmt.Errorf("invalid -no-pk-strategy %q: want skip, rowid or unique:<index>", s)
+}
+
+// primaryKey discovers and caches a table's primary key columns. If the
+// table has none, it falls back to opts.NoPKStrategy when that names a
+// unique index; otherwise it returns no columns and the caller decides how
+// to degrade (skip / rowid).
+func (r *MySQLRoot) primaryKey(ctx context.Context, table string) ([]pkColumn, error) {
+	if v, ok := pkCache.Load(table); ok {
+		e := v.(pkCacheEntry)
+		if time.Now().Before(e.expires) {
+			return e.cols, nil
+		}
+	}
+
+	cols, err := r.keyColumns(ctx, table, "PRIMARY")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cols) == 0 && r.opts.NoPKStrategy.Mode == "unique" {
+		cols, err = r.keyColumns(ctx, table, r.opts.NoPKStrategy.Index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pkCache.Store(table, pkCacheEntry{cols: cols, expires: time.Now().Add(schemaCacheTTL)})
+	return cols, nil
+}
+
+func (r *MySQLRoot) keyColumns(ctx context.Context, table string, constraintName string) ([]pkColumn, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT k.column_name, c.data_type
+		FROM information_schema.key_column_usage k
+		JOIN information_schema.columns c
+		  ON c.table_schema = k.table_schema AND c.table_name = k.table_name AND c.column_name = k.column_name
+		WHERE k.table_schema = DATABASE() AND k.table_name = ? AND k.constraint_name = ?
+		ORDER BY k.ordinal_position`, table, constraintName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []pkColumn
+	for rows.Next() {
+		var c pkColumn
+		if err := rows.Scan(&c.Name, &c.Type); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+// getRecordKeys lists the PKKey of every row in table, using the discovered
+// primary key (or the configured no-pk fallback).
+func (r *MySQLRoot) getRecordKeys(ctx context.Context, table string) ([]PKKey, error) {
+	pk, err := r.primaryKey(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pk) == 0 {
+		if r.opts.NoPKStrategy.Mode == "rowid" {
+			return r.getRowIDKeys(ctx, table)
+		}
+		// skip: no stable way to name rows, so the table directory is empty.
+		return nil, nil
+	}
+
+	names := make([]string, len(pk))
+	for i, c := range pk {
+		names[i] = fmt.Sprintf("`%s`", c.Name)
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(names, ", "), table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []PKKey
+	for rows.Next() {
+		raw := make([]sql.RawBytes, len(pk))
+		ptrs := make([]interface{}, len(pk))
+		for i := range raw {
+			ptrs[i] = &raw[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		key := make(PKKey, len(pk))
+		for i, v := range raw {
+			key[i] = string(v)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// getRowIDKeys numbers rows 0..N-1; a row is read back by its offset in an
+// unordered `SELECT *` (no ORDER BY), so the numbering follows whatever order
+// the server returns rows in. Since there's no real unique key, a row's
+// offset can shift under concurrent writes; this is only meant as a
+// last-resort browsing aid, not a stable identity.
+func (r *MySQLRoot) getRowIDKeys(ctx context.Context, table string) ([]PKKey, error) {
+	var n int64
+	if err := r.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table)).Scan(&n); err != nil {
+		return nil, err
+	}
+
+	keys := make([]PKKey, n)
+	for i := range keys {
+		keys[i] = PKKey{strconv.FormatInt(int64(i), 10)}
+	}
+	return keys, nil
+}
+
+// rowWhere builds a parameterized `col1 = ? AND col2 = ? ...` clause (plus
+// its args) for the given key over pk's columns, used by every row lookup
+// instead of string-interpolating the key into SQL.
+func rowWhere(pk []pkColumn, key PKKey) (string, []interface{}) {
+	conds := make([]string, len(pk))
+	args := make([]interface{}, len(pk))
+	for i, c := range pk {
+		conds[i] = fmt.Sprintf("`%s` = ?", c.Name)
+		args[i] = key[i]
+	}
+	return strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// sqlErrorXattr is where the SQL error from a failed write is surfaced,
+// since a plain EIO gives the caller no way to see what went wrong.
+const sqlErrorXattr = "user.sql_error"
+
+// RecordNode represents a single row as a FUSE file (table/{key}.json).
+// Reads render the row; writes accumulate into buf by offset (the kernel may
+// split a large write into several calls) and are committed as a single
+// UPDATE of the changed columns on Flush, since the configured RowFormatter
+// needs the whole serialized row to Parse, not a partial chunk. pk is empty
+// when the table has no usable key and opts.NoPKStrategy is "rowid", in
+// which case key is a positional row offset rather than a real column value.
+type RecordNode struct {
+	fs.Inode
+	root  *MySQLRoot
+	table string
+	pk    []pkColumn
+	key   PKKey
+
+	mu      sync.Mutex
+	buf     []byte
+	dirty   bool
+	lastErr string
+}
+
+func NewRecordNode(root *MySQLRoot, table string, pk []pkColumn, key PKKey) *RecordNode {
+	return &RecordNode{root: root, table: table, pk: pk, key: key}
+}
+
+var (
+	_ = (fs.NodeOpener)((*RecordNode)(nil))
+	_ = (fs.NodeReader)((*RecordNode)(nil))
+	_ = (fs.NodeWriter)((*RecordNode)(nil))
+	_ = (fs.NodeFlusher)((*RecordNode)(nil))
+	_ = (fs.NodeReleaser)((*RecordNode)(nil))
+	_ = (fs.NodeSetattrer)((*RecordNode)(nil))
+	_ = (fs.NodeGetattrer)((*RecordNode)(nil))
+	_ = (fs.NodeGetxattrer)((*RecordNode)(nil))
+)
+
+func (n *RecordNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	return nil, 0, fs.OK
+}
+
+func (n *RecordNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	body, err := n.render(ctx)
+	if err != nil {
+		return syscall.EIO
+	}
+	out.Attr.Mode = 0644
+	out.Attr.Size = uint64(len(body))
+	return fs.OK
+}
+
+func (n *RecordNode) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	// Truncation ahead of a full rewrite (e.g. `>`); the actual row only
+	// changes once the buffered write is committed on Flush/Release, so
+	// there's nothing to do here.
+	return n.Getattr(ctx, f, out)
+}
+
+func (n *RecordNode) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	body, err := n.render(ctx)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if off > int64(len(body)) {
+		off = int64(len(body))
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(body)) {
+		end = int64(len(body))
+	}
+	return fuse.ReadResultData(body[off:end]), fs.OK
+}
+
+func (n *RecordNode) Write(ctx context.Context, f fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	if n.root.opts.ReadOnly {
+		return 0, syscall.EROFS
+	}
+
+	n.mu.Lock()
+	end := off + int64(len(data))
+	if end > int64(len(n.buf)) {
+		n.buf = growBuf(n.buf, end)
+	}
+	copy(n.buf[off:end], data)
+	n.dirty = true
+	n.mu.Unlock()
+
+	return uint32(len(data)), fs.OK
+}
+
+// Flush commits the buffered write on close(2). Release does the same, in
+// case a client closes without flushing.
+func (n *RecordNode) Flush(ctx context.Context, f fs.FileHandle) syscall.Errno {
+	return n.commit(ctx)
+}
+
+func (n *RecordNode) Release(ctx context.Context, f fs.FileHandle) syscall.Errno {
+	return n.commit(ctx)
+}
+
+// growBuf extends buf to length end, growing its capacity geometrically so a
+// write split into many small chunks by the kernel doesn't re-copy the whole
+// accumulated buffer on every single chunk.
+func growBuf(buf []byte, end int64) []byte {
+	if int64(cap(buf)) >= end {
+		return buf[:end]
+	}
+	newCap := int64(cap(buf)) * 2
+	if newCap < end {
+		newCap = end
+	}
+	grown := make([]byte, len(buf), newCap)
+	copy(grown, buf)
+	return grown[:end]
+}
+
+func (n *RecordNode) commit(ctx context.Context) syscall.Errno {
+	n.mu.Lock()
+	if !n.dirty {
+		n.mu.Unlock()
+		return fs.OK
+	}
+	data := n.buf
+	n.buf = nil
+	n.dirty = false
+	n.mu.Unlock()
+
+	cols, err := n.root.opts.formatterFor(n.table).Parse(data)
+	if err != nil {
+		n.setErr(err)
+		return syscall.EIO
+	}
+
+	if err := n.update(ctx, cols); err != nil {
+		n.setErr(err)
+		return syscall.EIO
+	}
+
+	n.setErr(nil)
+	return fs.OK
+}
+
+func (n *RecordNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	if attr != sqlErrorXattr {
+		return 0, syscall.ENODATA
+	}
+
+	n.mu.Lock()
+	msg := n.lastErr
+	n.mu.Unlock()
+	if msg == "" {
+		return 0, syscall.ENODATA
+	}
+
+	if len(dest) < len(msg) {
+		return uint32(len(msg)), syscall.ERANGE
+	}
+	return uint32(copy(dest, msg)), fs.OK
+}
+
+func (n *RecordNode) setErr(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err == nil {
+		n.lastErr = ""
+		return
+	}
+	n.lastErr = err.Error()
+}
+
+// render fetches the row and serializes it with the table's configured
+// RowFormatter.
+func (n *RecordNode) render(ctx context.Context) ([]byte, error) {
+	row, cols, err := n.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return n.root.opts.formatterFor(n.table).Format(n.table, cols, row)
+}
+
+func (n *RecordNode) fetch(ctx context.Context) ([]string, []string, error) {
+	query := fmt.Sprintf("SELECT * FROM `%s`", n.table)
+	var args []interface{}
+
+	if len(n.pk) > 0 {
+		where, whereArgs := rowWhere(n.pk, n.key)
+		query += " WHERE " + where
+		args = whereArgs
+	} else {
+		// rowid fallback: no real key, so address the row by position.
+		offset, err := strconv.ParseInt(n.key[0], 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		query += fmt.Sprintf(" LIMIT %d, 1", offset)
+	}
+
+	rows, err := n.root.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !rows.Next() {
+		return nil, nil, fmt.Errorf("record %s not found in %s", n.key, n.table)
+	}
+
+	raw := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]string, len(cols))
+	for i, v := range raw {
+		values[i] = string(v)
+	}
+	return values, cols, rows.Err()
+}
+
+// update diffs cols against the current row and issues a parameterized
+// UPDATE for whatever changed.
+func (n *RecordNode) update(ctx context.Context, cols map[string]string) error {
+	if len(n.pk) == 0 {
+		return fmt.Errorf("table %s has no primary key to update by", n.table)
+	}
+
+	current, names, err := n.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	isPK := make(map[string]bool, len(n.pk))
+	for _, c := range n.pk {
+		isPK[c.Name] = true
+	}
+
+	var sets []string
+	var args []interface{}
+	for i, name := range names {
+		if isPK[name] {
+			continue
+		}
+		newVal, ok := cols[name]
+		if !ok || newVal == current[i] {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("`%s` = ?", name))
+		args = append(args, newVal)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	where, whereArgs := rowWhere(n.pk, n.key)
+	args = append(args, whereArgs...)
+
+	query := fmt.Sprintf("UPDATE `%s` SET %s WHERE %s", n.table, strings.Join(sets, ", "), where)
+	_, err = n.root.db.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// schemaCacheTTL bounds how long DDL/metadata pulled from information_schema
+// is reused before being re-queried.
+const schemaCacheTTL = 30 * time.Second
+
+// schemaCache memoizes the rendered content of a _schema/ file by key.
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[string]schemaCacheEntry
+}
+
+type schemaCacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{entries: map[string]schemaCacheEntry{}}
+}
+
+func (c *schemaCache) get(ctx context.Context, key string, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		return e.data, nil
+	}
+	c.mu.Unlock()
+
+	data, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = schemaCacheEntry{data: data, expires: time.Now().Add(schemaCacheTTL)}
+	c.mu.Unlock()
+	return data, nil
+}
+
+// SchemaRoot is the synthetic `_schema` directory, a sibling of the real
+// table directories, exposing DDL and information_schema metadata.
+type SchemaRoot struct {
+	fs.Inode
+	root  *MySQLRoot
+	cache *schemaCache
+}
+
+func NewSchemaRoot(root *MySQLRoot) *SchemaRoot {
+	return &SchemaRoot{root: root, cache: newSchemaCache()}
+}
+
+var _ = (fs.NodeOnAdder)((*SchemaRoot)(nil))
+
+func (s *SchemaRoot) OnAdd(ctx context.Context) {}
+
+func (s *SchemaRoot) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	list := []fuse.DirEntry{
+		{Name: "tables", Mode: 0755 | uint32(syscall.S_IFDIR)},
+	}
+	return fs.NewListDirStream(list), fs.OK
+}
+
+func (s *SchemaRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if name != "tables" {
+		return nil, syscall.ENOENT
+	}
+	sa := fs.StableAttr{Mode: 0755 | uint32(syscall.S_IFDIR)}
+	return s.NewInode(ctx, NewSchemaTablesNode(s.root, s.cache), sa), fs.OK
+}
+
+// SchemaTablesNode is `_schema/tables`: each table gets both a `<t>.sql`
+// file (the CREATE TABLE text) and a `<t>/` directory (columns/indexes/fks).
+type SchemaTablesNode struct {
+	fs.Inode
+	root  *MySQLRoot
+	cache *schemaCache
+}
+
+func NewSchemaTablesNode(root *MySQLRoot, cache *schemaCache) *SchemaTablesNode {
+	return &SchemaTablesNode{root: root, cache: cache}
+}
+
+func (s *SchemaTablesNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	tables, err := s.root.getTables(ctx)
+	if err != nil {
+		return nil, syscall.ENOENT
+	}
+
+	list := []fuse.DirEntry{}
+	for _, t := range tables {
+		list = append(list,
+			fuse.DirEntry{Name: t + ".sql", Mode: 0444 | uint32(syscall.S_IFREG)},
+			fuse.DirEntry{Name: t, Mode: 0555 | uint32(syscall.S_IFDIR)},
+		)
+	}
+	return fs.NewListDirStream(list), fs.OK
+}
+
+func (s *SchemaTablesNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if table := strings.TrimSuffix(name, ".sql"); table != name {
+		sa := fs.StableAttr{Mode: 0444 | uint32(syscall.S_IFREG)}
+		gen := func(ctx context.Context) ([]byte, error) { return s.root.showCreateTable(ctx, table) }
+		return s.NewInode(ctx, NewSchemaFileNode(s.cache, "tables/"+name, gen), sa), fs.OK
+	}
+
+	sa := fs.StableAttr{Mode: 0555 | uint32(syscall.S_IFDIR)}
+	return s.NewInode(ctx, NewSchemaTableNode(s.root, s.cache, name), sa), fs.OK
+}
+
+// SchemaTableNode is `_schema/tables/<t>`.
+type SchemaTableNode struct {
+	fs.Inode
+	root  *MySQLRoot
+	cache *schemaCache
+	table string
+}
+
+func NewSchemaTableNode(root *MySQLRoot, cache *schemaCache, table string) *SchemaTableNode {
+	return &SchemaTableNode{root: root, cache: cache, table: table}
+}
+
+func (s *SchemaTableNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	list := []fuse.DirEntry{
+		{Name: "columns.json", Mode: 0444 | uint32(syscall.S_IFREG)},
+		{Name: "indexes.json", Mode: 0444 | uint32(syscall.S_IFREG)},
+		{Name: "foreign_keys.json", Mode: 0444 | uint32(syscall.S_IFREG)},
+	}
+	return fs.NewListDirStream(list), fs.OK
+}
+
+func (s *SchemaTableNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	var gen func(ctx context.Context) ([]byte, error)
+	switch name {
+	case "columns.json":
+		gen = func(ctx context.Context) ([]byte, error) { return s.root.schemaColumnsJSON(ctx, s.table) }
+	case "indexes.json":
+		gen = func(ctx context.Context) ([]byte, error) { return s.root.schemaIndexesJSON(ctx, s.table) }
+	case "foreign_keys.json":
+		gen = func(ctx context.Context) ([]byte, error) { return s.root.schemaForeignKeysJSON(ctx, s.table) }
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	sa := fs.StableAttr{Mode: 0444 | uint32(syscall.S_IFREG)}
+	key := fmt.Sprintf("tables/%s/%s", s.table, name)
+	return s.NewInode(ctx, NewSchemaFileNode(s.cache, key, gen), sa), fs.OK
+}
+
+// SchemaFileNode is a read-only file under `_schema/` whose content is
+// computed by gen and memoized in cache.
+type SchemaFileNode struct {
+	fs.Inode
+	cache *schemaCache
+	key   string
+	gen   func(ctx context.Context) ([]byte, error)
+}
+
+func NewSchemaFileNode(cache *schemaCache, key string, gen func(ctx context.Context) ([]byte, error)) *SchemaFileNode {
+	return &SchemaFileNode{cache: cache, key: key, gen: gen}
+}
+
+var (
+	_ = (fs.NodeOpener)((*SchemaFileNode)(nil))
+	_ = (fs.NodeReader)((*SchemaFileNode)(nil))
+	_ = (fs.NodeGetattrer)((*SchemaFileNode)(nil))
+)
+
+func (s *SchemaFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	return nil, 0, fs.OK
+}
+
+func (s *SchemaFileNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	data, err := s.cache.get(ctx, s.key, s.gen)
+	if err != nil {
+		return syscall.EIO
+	}
+	out.Attr.Mode = 0444
+	out.Attr.Size = uint64(len(data))
+	return fs.OK
+}
+
+func (s *SchemaFileNode) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	data, err := s.cache.get(ctx, s.key, s.gen)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if off > int64(len(data)) {
+		off = int64(len(data))
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return fuse.ReadResultData(data[off:end]), fs.OK
+}
+
+func (r *MySQLRoot) showCreateTable(ctx context.Context, table string) ([]byte, error) {
+	if err := r.validateTable(ctx, table); err != nil {
+		return nil, err
+	}
+
+	row := r.db.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE `%s`", table))
+
+	var name, ddl string
+	if err := row.Scan(&name, &ddl); err != nil {
+		return nil, err
+	}
+	return []byte(ddl + ";\n"), nil
+}
+
+type schemaColumn struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default"`
+}
+
+func (r *MySQLRoot) schemaColumnsJSON(ctx context.Context, table string) ([]byte, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT column_name, column_type, is_nullable, column_default
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ?
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []schemaColumn
+	for rows.Next() {
+		var c schemaColumn
+		var nullable string
+		var def sql.NullString
+		if err := rows.Scan(&c.Name, &c.Type, &nullable, &def); err != nil {
+			return nil, err
+		}
+		c.Nullable = nullable == "YES"
+		if def.Valid {
+			c.Default = &def.String
+		}
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(cols, "", "  ")
+}
+
+type schemaIndex struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+func (r *MySQLRoot) schemaIndexesJSON(ctx context.Context, table string) ([]byte, error) {
+	if err := r.validateTable(ctx, table); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf("SHOW INDEX FROM `%s`", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*schemaIndex{}
+	var order []string
+	for rows.Next() {
+		raw := make([]sql.RawBytes, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range raw {
+			ptrs[i] = &raw[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		field := map[string]string{}
+		for i, c := range cols {
+			field[c] = string(raw[i])
+		}
+
+		name := field["Key_name"]
+		idx, ok := byName[name]
+		if !ok {
+			idx = &schemaIndex{Name: name, Unique: field["Non_unique"] == "0"}
+			byName[name] = idx
+			order = append(order, name)
+		}
+		idx.Columns = append(idx.Columns, field["Column_name"])
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]schemaIndex, 0, len(order))
+	for _, name := range order {
+		indexes = append(indexes, *byName[name])
+	}
+	return json.MarshalIndent(indexes, "", "  ")
+}
+
+type schemaForeignKey struct {
+	Name             string `json:"name"`
+	Column           string `json:"column"`
+	ReferencedTable  string `json:"referenced_table"`
+	ReferencedColumn string `json:"referenced_column"`
+}
+
+func (r *MySQLRoot) schemaForeignKeysJSON(ctx context.Context, table string) ([]byte, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT constraint_name, column_name, referenced_table_name, referenced_column_name
+		FROM information_schema.key_column_usage
+		WHERE table_schema = DATABASE() AND table_name = ? AND referenced_table_name IS NOT NULL`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []schemaForeignKey
+	for rows.Next() {
+		var fk schemaForeignKey
+		if err := rows.Scan(&fk.Name, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn); err != nil {
+			return nil, err
+		}
+		fks = append(fks, fk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(fks, "", "  ")
+}